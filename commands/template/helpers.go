@@ -0,0 +1,71 @@
+package template
+
+import (
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pinzolo/casee"
+)
+
+// HelperFuncMap returns the helper functions shared by both filename and
+// file content templating. Available helpers:
+//
+//	upper, lower, title   - case conversion
+//	snake, kebab          - word_case / word-case conversion
+//	camel, pascal         - camelCase / PascalCase conversion
+//	replace old new s     - strings.ReplaceAll
+//	trim                  - strings.TrimSpace
+//	split sep s           - strings.Split
+//	default def val       - val if it is a non-empty string, otherwise def
+//	env name              - read an environment variable
+//	uuid                  - a random v4 UUID
+//	now                   - current time, RFC3339
+//	date layout            - current time formatted with layout
+//	add, sub, mul, div    - integer arithmetic
+func HelperFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"upper":   strings.ToUpper,
+		"lower":   strings.ToLower,
+		"title":   strings.Title,
+		"snake":   casee.ToSnakeCase,
+		"kebab":   toKebabCase,
+		"camel":   casee.ToCamelCase,
+		"pascal":  casee.ToPascalCase,
+		"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"trim":    strings.TrimSpace,
+		"split":   strings.Split,
+		"default": defaultValue,
+		"env":     os.Getenv,
+		"uuid":    func() string { return uuid.New().String() },
+		"now":     func() string { return time.Now().Format(time.RFC3339) },
+		"date":    func(layout string) string { return time.Now().Format(layout) },
+		"add":     func(a, b int) int { return a + b },
+		"sub":     func(a, b int) int { return a - b },
+		"mul":     func(a, b int) int { return a * b },
+		"div":     func(a, b int) int { return a / b },
+
+		// kept for templates written against the original helper set
+		"toCamelCase":  casee.ToCamelCase,
+		"toPascalCase": casee.ToPascalCase,
+		"toSnakeCase":  casee.ToSnakeCase,
+		"join":         strings.Join,
+	}
+}
+
+// toKebabCase converts a string to kebab-case.
+func toKebabCase(s string) string {
+	return strings.ReplaceAll(casee.ToSnakeCase(s), "_", "-")
+}
+
+// defaultValue returns val unless it is the empty string, in which case
+// def is returned instead. It mirrors the common `default` template
+// helper used for optional variables.
+func defaultValue(def, val string) string {
+	if val == "" {
+		return def
+	}
+	return val
+}
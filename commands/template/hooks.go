@@ -0,0 +1,96 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	logy "github.com/apex/log"
+)
+
+// runHooks executes each hook in dir in order, skipping those declared
+// for a different OS. A non-zero exit from any hook aborts the run.
+func (t *Templating) runHooks(hooks []HookCommand, dir string) error {
+	env := t.hookEnv()
+
+	for _, h := range hooks {
+		if h.OS != "" && h.OS != runtime.GOOS {
+			continue
+		}
+
+		cmd, err := buildHookCmd(h, dir, env)
+		if err != nil {
+			return err
+		}
+
+		logy.Debugf("running hook: %s", hookLabel(h))
+
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("hook %q failed: %w", hookLabel(h), err)
+		}
+	}
+
+	return nil
+}
+
+// buildHookCmd builds the exec.Cmd for a hook, dispatching on whether it
+// declares a shell command (Run) or an argv (Exec).
+func buildHookCmd(h HookCommand, dir string, env []string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+
+	switch {
+	case len(h.Exec) > 0:
+		cmd = exec.Command(h.Exec[0], h.Exec[1:]...)
+	case h.Run != "":
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		cmd = exec.Command(shell, flag, h.Run)
+	default:
+		return nil, fmt.Errorf("hook has neither 'run' nor 'exec' set")
+	}
+
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	return cmd, nil
+}
+
+func hookLabel(h HookCommand) string {
+	if len(h.Exec) > 0 {
+		return strings.Join(h.Exec, " ")
+	}
+	return h.Run
+}
+
+// hookEnv exposes the project data, configured variables and survey
+// answers to hook processes as BUTLER_* environment variables. It mirrors
+// templateData field for field so a hook sees exactly what the rendered
+// files saw.
+func (t *Templating) hookEnv() []string {
+	env := []string{
+		"BUTLER_PROJECT_NAME=" + t.project.Name,
+		"BUTLER_PROJECT_PATH=" + t.project.Path,
+		"BUTLER_PROJECT_TEMPLATE=" + t.project.Template,
+		"BUTLER_PROJECT_DESCRIPTION=" + t.project.Description,
+		"BUTLER_DATE=" + t.renderDate,
+		"BUTLER_YEAR=" + strconv.Itoa(t.renderYear),
+	}
+
+	for k, v := range t.Variables {
+		env = append(env, fmt.Sprintf("BUTLER_VAR_%s=%s", strings.ToUpper(k), v))
+	}
+
+	for k, v := range t.surveyResult {
+		env = append(env, fmt.Sprintf("BUTLER_PROMPT_%s=%v", strings.ToUpper(k), v))
+	}
+
+	return env
+}
@@ -0,0 +1,235 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	toml "github.com/BurntSushi/toml"
+	survey "gopkg.in/AlecAivazis/survey.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PromptType enumerates the kind of question a manifest prompt renders as.
+type PromptType string
+
+// Supported prompt types.
+const (
+	PromptString      PromptType = "string"
+	PromptBool        PromptType = "bool"
+	PromptSelect      PromptType = "select"
+	PromptMultiSelect PromptType = "multiselect"
+)
+
+type (
+	// PromptDef describes a single question asked when scaffolding a
+	// template, as declared in template.toml/template.yaml.
+	PromptDef struct {
+		Name      string     `toml:"name" yaml:"name"`
+		Type      PromptType `toml:"type" yaml:"type"`
+		Prompt    string     `toml:"prompt" yaml:"prompt"`
+		Help      string     `toml:"help" yaml:"help"`
+		Default   string     `toml:"default" yaml:"default"`
+		Options   []string   `toml:"options" yaml:"options"`
+		DependsOn string     `toml:"depends_on" yaml:"depends_on"`
+	}
+
+	// Manifest is the structured description of a template's prompts and
+	// generation hooks.
+	Manifest struct {
+		Prompts []PromptDef `toml:"prompts" yaml:"prompts"`
+		Hooks   Hooks       `toml:"hooks" yaml:"hooks"`
+	}
+
+	// Hooks are commands a template runs before/after the project is
+	// rendered, e.g. `go mod tidy` or `npm install`.
+	Hooks struct {
+		BeforeRender []HookCommand `toml:"before_render" yaml:"before_render"`
+		AfterRender  []HookCommand `toml:"after_render" yaml:"after_render"`
+	}
+
+	// HookCommand is a single hook invocation. Exactly one of Run (a
+	// shell command) or Exec (an argv, run directly without a shell)
+	// should be set. OS restricts the hook to a single platform
+	// ("linux", "darwin", "windows"); empty means every platform.
+	HookCommand struct {
+		Run  string   `toml:"run" yaml:"run"`
+		Exec []string `toml:"exec" yaml:"exec"`
+		OS   string   `toml:"os" yaml:"os"`
+	}
+)
+
+// envRefPattern matches ${NAME} style references inside a prompt default.
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ReadSurveyConfig loads and parses the template manifest at path. The
+// format (TOML or YAML) is chosen by file extension.
+func ReadSurveyConfig(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, fmt.Errorf("parse template manifest: %w", err)
+		}
+	default:
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("parse template manifest: %w", err)
+		}
+	}
+
+	return &m, nil
+}
+
+// BuildSurveys orders the manifest prompts so that every prompt is
+// preceded by the prompts it depends on.
+func BuildSurveys(m *Manifest) ([]PromptDef, error) {
+	return sortPromptsByDependency(m.Prompts)
+}
+
+// sortPromptsByDependency performs a topological sort of prompts on their
+// depends_on field with a depth-first visit, reporting cycles and
+// references to unknown prompts as errors.
+func sortPromptsByDependency(prompts []PromptDef) ([]PromptDef, error) {
+	byName := make(map[string]PromptDef, len(prompts))
+	for _, p := range prompts {
+		byName[p.Name] = p
+	}
+
+	var visit func(name string, trail []string) ([]PromptDef, error)
+	visited := make(map[string]bool)
+	var sorted []PromptDef
+
+	visit = func(name string, trail []string) ([]PromptDef, error) {
+		if visited[name] {
+			return sorted, nil
+		}
+		for _, t := range trail {
+			if t == name {
+				return nil, fmt.Errorf("cyclic depends_on involving prompt %q", name)
+			}
+		}
+
+		p, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("prompt %q depends_on unknown prompt %q", trail[len(trail)-1], name)
+		}
+
+		if p.DependsOn != "" {
+			if _, err := visit(p.DependsOn, append(trail, name)); err != nil {
+				return nil, err
+			}
+		}
+
+		if !visited[name] {
+			visited[name] = true
+			sorted = append(sorted, p)
+		}
+
+		return sorted, nil
+	}
+
+	for _, p := range prompts {
+		if _, err := visit(p.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// expandDefault resolves ${ENV_VAR} and ${BUTLER_PROMPT_<KEY>} references
+// inside a prompt default, the latter against answers already collected.
+func expandDefault(def string, answers map[string]interface{}) string {
+	return envRefPattern.ReplaceAllStringFunc(def, func(match string) string {
+		name := envRefPattern.FindStringSubmatch(match)[1]
+
+		if strings.HasPrefix(name, "BUTLER_PROMPT_") {
+			key := strings.TrimPrefix(name, "BUTLER_PROMPT_")
+			for k, v := range answers {
+				if strings.EqualFold(k, key) {
+					return fmt.Sprintf("%v", v)
+				}
+			}
+			return ""
+		}
+
+		return os.Getenv(name)
+	})
+}
+
+// buildQuestion turns a manifest prompt into a survey.v1 question.
+func buildQuestion(p PromptDef, def string) *survey.Question {
+	q := &survey.Question{Name: p.Name}
+
+	switch p.Type {
+	case PromptBool:
+		b, _ := strconv.ParseBool(def)
+		q.Prompt = &survey.Confirm{Message: p.Prompt, Help: p.Help, Default: b}
+	case PromptSelect:
+		q.Prompt = &survey.Select{Message: p.Prompt, Help: p.Help, Options: p.Options, Default: def}
+	case PromptMultiSelect:
+		q.Prompt = &survey.MultiSelect{Message: p.Prompt, Help: p.Help, Options: p.Options}
+	default:
+		q.Prompt = &survey.Input{Message: p.Prompt, Help: p.Help, Default: def}
+	}
+
+	return q
+}
+
+// butlerVarOverride returns the BUTLER_VAR_<NAME> env override for a
+// prompt, if one was set, allowing non-interactive runs to skip the
+// prompt entirely.
+func butlerVarOverride(name string) (string, bool) {
+	return os.LookupEnv("BUTLER_VAR_" + strings.ToUpper(name))
+}
+
+// runPrompts asks every prompt in order, expanding its default from env
+// vars and previously collected answers before asking it. A value found
+// in the answers file or a BUTLER_VAR_<NAME> env override always wins
+// over prompting, and WithDefaults(true) falls back to the (expanded)
+// declared default instead of prompting.
+func (t *Templating) runPrompts(prompts []PromptDef, results map[string]interface{}) error {
+	seed, err := t.loadAnswers()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range prompts {
+		if v, ok := seed[p.Name]; ok {
+			results[p.Name] = v
+			continue
+		}
+
+		if v, ok := butlerVarOverride(p.Name); ok {
+			results[p.Name] = v
+			continue
+		}
+
+		def := expandDefault(p.Default, results)
+
+		if t.defaults {
+			results[p.Name] = def
+			continue
+		}
+
+		q := buildQuestion(p, def)
+
+		var answer interface{}
+		if err := survey.AskOne(q.Prompt, &answer, q.Validate); err != nil {
+			return err
+		}
+
+		results[p.Name] = answer
+	}
+
+	return nil
+}
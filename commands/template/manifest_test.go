@@ -0,0 +1,87 @@
+package template
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSortPromptsByDependencyOrdersDependents(t *testing.T) {
+	prompts := []PromptDef{
+		{Name: "B", DependsOn: "A"},
+		{Name: "A"},
+	}
+
+	sorted, err := sortPromptsByDependency(prompts)
+	if err != nil {
+		t.Fatalf("sortPromptsByDependency: %v", err)
+	}
+
+	if len(sorted) != 2 || sorted[0].Name != "A" || sorted[1].Name != "B" {
+		t.Fatalf("expected [A B], got %v", names(sorted))
+	}
+}
+
+func TestSortPromptsByDependencyDetectsCycle(t *testing.T) {
+	prompts := []PromptDef{
+		{Name: "A", DependsOn: "B"},
+		{Name: "B", DependsOn: "A"},
+	}
+
+	if _, err := sortPromptsByDependency(prompts); err == nil {
+		t.Fatal("expected an error for a cyclic depends_on, got nil")
+	}
+}
+
+func TestSortPromptsByDependencyDetectsSelfReference(t *testing.T) {
+	prompts := []PromptDef{
+		{Name: "A", DependsOn: "A"},
+	}
+
+	if _, err := sortPromptsByDependency(prompts); err == nil {
+		t.Fatal("expected an error for a self-referential depends_on, got nil")
+	}
+}
+
+func TestSortPromptsByDependencyDetectsUnknownTarget(t *testing.T) {
+	prompts := []PromptDef{
+		{Name: "A", DependsOn: "missing"},
+	}
+
+	if _, err := sortPromptsByDependency(prompts); err == nil {
+		t.Fatal("expected an error for an unknown depends_on target, got nil")
+	}
+}
+
+func names(prompts []PromptDef) []string {
+	out := make([]string, len(prompts))
+	for i, p := range prompts {
+		out[i] = p.Name
+	}
+	return out
+}
+
+func TestExpandDefaultResolvesPromptAnswer(t *testing.T) {
+	answers := map[string]interface{}{"Name": "acme"}
+
+	got := expandDefault("${BUTLER_PROMPT_NAME}-service", answers)
+	if got != "acme-service" {
+		t.Fatalf("expected %q, got %q", "acme-service", got)
+	}
+}
+
+func TestExpandDefaultUnresolvedPromptAnswerIsBlank(t *testing.T) {
+	got := expandDefault("${BUTLER_PROMPT_NAME}-service", map[string]interface{}{})
+	if got != "-service" {
+		t.Fatalf("expected a blank substitution for a not-yet-collected answer, got %q", got)
+	}
+}
+
+func TestExpandDefaultResolvesEnvVar(t *testing.T) {
+	os.Setenv("BUTLER_MANIFEST_TEST_VAR", "env-value")
+	defer os.Unsetenv("BUTLER_MANIFEST_TEST_VAR")
+
+	got := expandDefault("${BUTLER_MANIFEST_TEST_VAR}", nil)
+	if got != "env-value" {
+		t.Fatalf("expected %q, got %q", "env-value", got)
+	}
+}
@@ -0,0 +1,273 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	logy "github.com/apex/log"
+	"github.com/netzkern/butler/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	registryManifestName = "registry.yaml"
+	registryDirName      = ".butler/registry"
+)
+
+type (
+	// RegistryEntry describes a single cached template inside the registry.
+	RegistryEntry struct {
+		Name       string    `yaml:"name"`
+		Repository string    `yaml:"repository"`
+		Branch     string    `yaml:"branch,omitempty"`
+		Tag        string    `yaml:"tag,omitempty"`
+		Subdir     string    `yaml:"subdir,omitempty"`
+		Type       string    `yaml:"type,omitempty"`
+		Checksum   string    `yaml:"checksum,omitempty"`
+		UpdatedAt  time.Time `yaml:"updatedAt"`
+	}
+
+	// RegistryManifest is the on-disk index of all cached templates.
+	RegistryManifest struct {
+		Templates []RegistryEntry `yaml:"templates"`
+	}
+
+	// Registry manages templates cached on disk so `butler` can scaffold
+	// projects without talking to a remote repository every time.
+	Registry struct {
+		dir      string
+		manifest RegistryManifest
+	}
+)
+
+// defaultRegistryDir returns the default location of the local registry,
+// e.g. ~/.butler/registry.
+func defaultRegistryDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, registryDirName), nil
+}
+
+// NewRegistry loads (or initializes) the registry rooted at dir. When dir is
+// empty the default `~/.butler/registry` location is used.
+func NewRegistry(dir string) (*Registry, error) {
+	if dir == "" {
+		d, err := defaultRegistryDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = d
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	r := &Registry{dir: dir}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Registry) manifestPath() string {
+	return filepath.Join(r.dir, registryManifestName)
+}
+
+func (r *Registry) load() error {
+	data, err := ioutil.ReadFile(r.manifestPath())
+	if os.IsNotExist(err) {
+		r.manifest = RegistryManifest{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(data, &r.manifest)
+}
+
+func (r *Registry) save() error {
+	data, err := yaml.Marshal(&r.manifest)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.manifestPath(), data, 0644)
+}
+
+// entryIndex returns the index of the entry with the given name, or -1.
+func (r *Registry) entryIndex(name string) int {
+	for i, e := range r.manifest.Templates {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has reports whether a template is already cached in the registry.
+func (r *Registry) Has(name string) bool {
+	return r.entryIndex(name) != -1
+}
+
+// Path returns the local filesystem path of a cached template.
+func (r *Registry) Path(name string) string {
+	return filepath.Join(r.dir, name)
+}
+
+// ListTemplates returns all templates currently cached in the registry.
+func (r *Registry) ListTemplates() []RegistryEntry {
+	return r.manifest.Templates
+}
+
+// SaveTemplate fetches tpl's Source into the registry and records it in
+// the manifest. It is the entry point used when a template is fetched
+// for the first time, and when it is later updated.
+func (r *Registry) SaveTemplate(tpl *config.Template) error {
+	src, err := sourceForTemplate(tpl)
+	if err != nil {
+		return err
+	}
+
+	dest := r.Path(tpl.Name)
+	os.RemoveAll(dest)
+
+	if err := src.Fetch(dest); err != nil {
+		return fmt.Errorf("save template %s: %w", tpl.Name, err)
+	}
+
+	checksum, err := checksumDir(dest)
+	if err != nil {
+		return err
+	}
+
+	entry := RegistryEntry{
+		Name:       tpl.Name,
+		Repository: tpl.Url,
+		Branch:     tpl.Branch,
+		Tag:        tpl.Tag,
+		Subdir:     tpl.Subdir,
+		Type:       tpl.Type,
+		Checksum:   checksum,
+		UpdatedAt:  time.Now(),
+	}
+
+	if idx := r.entryIndex(tpl.Name); idx != -1 {
+		r.manifest.Templates[idx] = entry
+	} else {
+		r.manifest.Templates = append(r.manifest.Templates, entry)
+	}
+
+	return r.save()
+}
+
+// UpdateTemplate re-fetches a cached template from its upstream source.
+func (r *Registry) UpdateTemplate(name string) error {
+	idx := r.entryIndex(name)
+	if idx == -1 {
+		return fmt.Errorf("template %s is not cached, nothing to update", name)
+	}
+
+	entry := r.manifest.Templates[idx]
+	logy.Debugf("updating cached template %s from %s", name, entry.Repository)
+
+	return r.SaveTemplate(&config.Template{
+		Name:   entry.Name,
+		Url:    entry.Repository,
+		Branch: entry.Branch,
+		Tag:    entry.Tag,
+		Subdir: entry.Subdir,
+		Type:   entry.Type,
+	})
+}
+
+// RemoveTemplate deletes a cached template and its manifest entry.
+func (r *Registry) RemoveTemplate(name string) error {
+	idx := r.entryIndex(name)
+	if idx == -1 {
+		return fmt.Errorf("template %s is not cached", name)
+	}
+
+	if err := os.RemoveAll(r.Path(name)); err != nil {
+		return err
+	}
+
+	r.manifest.Templates = append(r.manifest.Templates[:idx], r.manifest.Templates[idx+1:]...)
+
+	return r.save()
+}
+
+// copyDir recursively copies the contents of src into dst, creating dst if
+// necessary. It is used to materialize a project from a cached template
+// without touching the network.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(target, data, info.Mode())
+	})
+}
+
+// checksumDir hashes the relative paths and contents of every file in dir
+// so callers can detect when a cached template has changed upstream.
+func checksumDir(dir string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		io.WriteString(h, rel)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
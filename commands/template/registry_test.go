@@ -0,0 +1,143 @@
+package template
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/netzkern/butler/config"
+)
+
+// newLocalTemplateSource writes a single-file template fixture to a fresh
+// temp dir and returns a config.Template pointing at it via the "local"
+// source type, so registry tests never touch the network.
+func newLocalTemplateSource(t *testing.T, name, content string) (*config.Template, string) {
+	t.Helper()
+
+	src, err := ioutil.TempDir("", "butler-registry-source-")
+	if err != nil {
+		t.Fatalf("create source dir: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte(content), 0644); err != nil {
+		t.Fatalf("write fixture file: %v", err)
+	}
+
+	return &config.Template{Name: name, Url: src, Type: "local"}, src
+}
+
+func TestRegistrySaveLoadRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "butler-registry-")
+	if err != nil {
+		t.Fatalf("create registry dir: %v", err)
+	}
+
+	r, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	tpl, _ := newLocalTemplateSource(t, "demo", "hello")
+
+	if err := r.SaveTemplate(tpl); err != nil {
+		t.Fatalf("SaveTemplate: %v", err)
+	}
+
+	// reload the registry from disk as a fresh process would
+	reloaded, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry (reload): %v", err)
+	}
+
+	if !reloaded.Has("demo") {
+		t.Fatal("expected reloaded registry to have the saved template")
+	}
+
+	entries := reloaded.ListTemplates()
+	if len(entries) != 1 || entries[0].Name != "demo" {
+		t.Fatalf("expected a single 'demo' entry, got %+v", entries)
+	}
+	if entries[0].Checksum == "" {
+		t.Fatal("expected a non-empty checksum to have been recorded")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(reloaded.Path("demo"), "file.txt"))
+	if err != nil {
+		t.Fatalf("read cached file: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected cached content %q, got %q", "hello", string(data))
+	}
+}
+
+func TestRegistryRemoveTemplateUnknown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "butler-registry-")
+	if err != nil {
+		t.Fatalf("create registry dir: %v", err)
+	}
+
+	r, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	if err := r.RemoveTemplate("missing"); err == nil {
+		t.Fatal("expected an error removing a template that isn't cached")
+	}
+}
+
+func TestRegistryUpdateTemplateRefetches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "butler-registry-")
+	if err != nil {
+		t.Fatalf("create registry dir: %v", err)
+	}
+
+	r, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	tpl, srcDir := newLocalTemplateSource(t, "demo", "v1")
+
+	if err := r.SaveTemplate(tpl); err != nil {
+		t.Fatalf("SaveTemplate: %v", err)
+	}
+
+	firstChecksum := r.ListTemplates()[0].Checksum
+
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("v2"), 0644); err != nil {
+		t.Fatalf("update fixture file: %v", err)
+	}
+
+	if err := r.UpdateTemplate("demo"); err != nil {
+		t.Fatalf("UpdateTemplate: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(r.Path("demo"), "file.txt"))
+	if err != nil {
+		t.Fatalf("read cached file: %v", err)
+	}
+	if string(data) != "v2" {
+		t.Fatalf("expected the update to re-fetch content %q, got %q", "v2", string(data))
+	}
+
+	if r.ListTemplates()[0].Checksum == firstChecksum {
+		t.Fatal("expected the checksum to change after updating to new content")
+	}
+}
+
+func TestRegistryUpdateTemplateUnknown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "butler-registry-")
+	if err != nil {
+		t.Fatalf("create registry dir: %v", err)
+	}
+
+	r, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	if err := r.UpdateTemplate("missing"); err == nil {
+		t.Fatal("expected an error updating a template that isn't cached")
+	}
+}
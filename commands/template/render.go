@@ -0,0 +1,33 @@
+package template
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// renderTemplate parses and executes body with Butler's delimiters and
+// helper functions, returning the rendered output. It is the single
+// entry point used for filename and file content templating, shared by
+// both Run and Validate.
+//
+// When strict is true, referencing an undeclared map key is a hard error
+// instead of silently producing the zero value - used by Validate to
+// surface unresolved variables that Run would otherwise print as blank.
+func renderTemplate(name, body string, data interface{}, funcMap template.FuncMap, strict bool) (string, error) {
+	tpl := template.New(name).Delims(startDelim, endDelim).Funcs(funcMap)
+	if strict {
+		tpl = tpl.Option("missingkey=error")
+	}
+
+	tpl, err := tpl.Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
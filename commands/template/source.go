@@ -0,0 +1,133 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver"
+	"github.com/netzkern/butler/config"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Source fetches a template's files into dest, creating it if necessary.
+type Source interface {
+	Fetch(dest string) error
+}
+
+type (
+	// GitSource fetches a template from a git repository, optionally
+	// pinned to a branch or tag and/or scoped to a subdirectory so a
+	// single monorepo can host several templates.
+	GitSource struct {
+		URL    string
+		Ref    string
+		IsTag  bool
+		Subdir string
+	}
+
+	// LocalSource copies a template from a path on the local
+	// filesystem, useful for offline template development.
+	LocalSource struct {
+		Path string
+	}
+
+	// ArchiveSource downloads and extracts a .tar.gz/.zip template
+	// archive.
+	ArchiveSource struct {
+		URL string
+	}
+)
+
+// Fetch clones the repository into dest, checking out Ref when set and
+// keeping only Subdir when set.
+func (s GitSource) Fetch(dest string) error {
+	opts := &git.CloneOptions{URL: s.URL}
+	if s.Ref != "" {
+		if s.IsTag {
+			opts.ReferenceName = plumbing.NewTagReferenceName(s.Ref)
+		} else {
+			opts.ReferenceName = plumbing.NewBranchReferenceName(s.Ref)
+		}
+	}
+
+	if s.Subdir == "" {
+		if _, err := git.PlainClone(dest, false, opts); err != nil {
+			return fmt.Errorf("clone %s: %w", s.URL, err)
+		}
+		return nil
+	}
+
+	tmp, err := ioutil.TempDir("", "butler-source-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := git.PlainClone(tmp, false, opts); err != nil {
+		return fmt.Errorf("clone %s: %w", s.URL, err)
+	}
+
+	return copyDir(filepath.Join(tmp, s.Subdir), dest)
+}
+
+// Fetch copies the local template directory into dest.
+func (s LocalSource) Fetch(dest string) error {
+	return copyDir(s.Path, dest)
+}
+
+// Fetch downloads and extracts the archive at URL into dest.
+func (s ArchiveSource) Fetch(dest string) error {
+	// archiver picks the format by extension, and filepath.Ext would turn
+	// ".tar.gz" into a bare ".gz" that it cannot extract
+	ext := filepath.Ext(s.URL)
+	if strings.HasSuffix(strings.ToLower(s.URL), ".tar.gz") {
+		ext = ".tar.gz"
+	}
+
+	tmpFile, err := ioutil.TempFile("", "butler-archive-*"+ext)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: unexpected status %s", s.URL, resp.Status)
+	}
+
+	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+		return err
+	}
+
+	return archiver.Unarchive(tmpFile.Name(), dest)
+}
+
+// sourceForTemplate builds the Source declared by a config.Template.
+func sourceForTemplate(tpl *config.Template) (Source, error) {
+	switch tpl.Type {
+	case "", "git":
+		ref, isTag := tpl.Branch, false
+		if ref == "" && tpl.Tag != "" {
+			ref, isTag = tpl.Tag, true
+		}
+		return GitSource{URL: tpl.Url, Ref: ref, IsTag: isTag, Subdir: tpl.Subdir}, nil
+	case "local":
+		return LocalSource{Path: tpl.Url}, nil
+	case "archive":
+		return ArchiveSource{URL: tpl.Url}, nil
+	default:
+		return nil, fmt.Errorf("template %s: unknown type %q", tpl.Name, tpl.Type)
+	}
+}
@@ -1,7 +1,6 @@
 package template
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -12,15 +11,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	logy "github.com/apex/log"
 	"github.com/briandowns/spinner"
 	"github.com/netzkern/butler/config"
-	"github.com/pinzolo/casee"
 	survey "gopkg.in/AlecAivazis/survey.v1"
-	git "gopkg.in/src-d/go-git.v4"
+	yaml "gopkg.in/yaml.v2"
 )
 
 const (
@@ -45,8 +42,20 @@ type (
 		excludedExts map[string]struct{}
 		ch           chan func()
 		wg           sync.WaitGroup
+		stopOnce     sync.Once
 		surveyResult map[string]interface{}
 		project      *ProjectData
+		registry     *Registry
+		offline      bool
+		update       bool
+		defaults     bool
+		force        bool
+		answersFile  string
+		answers      map[string]interface{}
+		dryRun       bool
+		manifest     *Manifest
+		renderDate   string
+		renderYear   int
 	}
 )
 
@@ -89,17 +98,142 @@ func WithTemplates(s []config.Template) Option {
 	}
 }
 
-// cloneRepo clone a repo to the dst
-func (t *Templating) cloneRepo(repoURL string, dest string) error {
-	_, err := git.PlainClone(dest, false, &git.CloneOptions{
-		URL: repoURL,
-	})
+// WithOffline option. When enabled, Run never touches the network and
+// fails when a template is not already present in the local registry.
+func WithOffline(b bool) Option {
+	return func(v *Templating) {
+		v.offline = b
+	}
+}
+
+// WithUpdate option. When enabled, Run re-fetches the template from its
+// repository even if a cached copy already exists in the local registry.
+func WithUpdate(b bool) Option {
+	return func(v *Templating) {
+		v.update = b
+	}
+}
+
+// WithDefaults option. When enabled, Run answers every prompt with its
+// declared default instead of asking interactively, so it can run
+// without a TTY.
+func WithDefaults(b bool) Option {
+	return func(v *Templating) {
+		v.defaults = b
+	}
+}
+
+// WithForce option. When enabled, Run removes an existing non-empty
+// destination, with all of its current contents, instead of failing, and
+// lets a rendered filename overwrite a file that already has that name.
+func WithForce(b bool) Option {
+	return func(v *Templating) {
+		v.force = b
+	}
+}
+
+// WithDryRun option. When enabled, Run validates the template in the
+// local registry instead of generating the project - see Validate. The
+// template is still fetched into the registry if it isn't cached there.
+func WithDryRun(b bool) Option {
+	return func(v *Templating) {
+		v.dryRun = b
+	}
+}
+
+// WithAnswersFile option. Points to a YAML file of pre-computed answers
+// (keyed by question name) used instead of prompting, e.g. in CI.
+func WithAnswersFile(path string) Option {
+	return func(v *Templating) {
+		v.answersFile = path
+	}
+}
+
+// loadAnswers lazily reads the configured answers file, if any.
+func (t *Templating) loadAnswers() (map[string]interface{}, error) {
+	if t.answers != nil {
+		return t.answers, nil
+	}
 
-	if err == git.ErrRepositoryAlreadyExists {
-		return fmt.Errorf("respository already exists. Remove '%s' directory", dest)
+	answers := make(map[string]interface{})
+	if t.answersFile != "" {
+		data, err := ioutil.ReadFile(t.answersFile)
+		if err != nil {
+			return nil, fmt.Errorf("read answers file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &answers); err != nil {
+			return nil, fmt.Errorf("parse answers file: %w", err)
+		}
+	}
+
+	t.answers = answers
+	return answers, nil
+}
+
+// ensureRegistry lazily opens the local template registry.
+func (t *Templating) ensureRegistry() (*Registry, error) {
+	if t.registry == nil {
+		r, err := NewRegistry("")
+		if err != nil {
+			return nil, err
+		}
+		t.registry = r
+	}
+
+	return t.registry, nil
+}
+
+// ensureTemplateCached makes sure tpl is present in the local registry,
+// fetching or re-fetching it as cloneRepo would, and returns its cached
+// path without copying it anywhere. Callers that don't need a private
+// writable copy of the template (e.g. a dry run) can validate this path
+// directly instead of paying for a copy they'll just discard.
+func (t *Templating) ensureTemplateCached(tpl *config.Template) (string, error) {
+	registry, err := t.ensureRegistry()
+	if err != nil {
+		return "", err
+	}
+
+	cached := registry.Has(tpl.Name)
+
+	if cached && !t.update {
+		logy.Debugf("using cached template %s from registry", tpl.Name)
+		return registry.Path(tpl.Name), nil
+	}
+
+	if t.offline {
+		if cached {
+			return "", fmt.Errorf("cannot update %s while offline", tpl.Name)
+		}
+		return "", fmt.Errorf("template %s is not cached and offline mode is enabled", tpl.Name)
 	}
 
-	return err
+	if err := registry.SaveTemplate(tpl); err != nil {
+		return "", err
+	}
+
+	return registry.Path(tpl.Name), nil
+}
+
+// cloneRepo clone a repo to the dst. When the local registry already
+// contains the template it is copied from there instead of hitting the
+// network, unless an update was explicitly requested.
+func (t *Templating) cloneRepo(tpl *config.Template, dest string) error {
+	if entries, err := ioutil.ReadDir(dest); err == nil && len(entries) > 0 {
+		if !t.force {
+			return fmt.Errorf("destination '%s' already exists. Remove it or run with --force", dest)
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+	}
+
+	cachedPath, err := t.ensureTemplateCached(tpl)
+	if err != nil {
+		return err
+	}
+
+	return copyDir(cachedPath, dest)
 }
 
 // getTemplateByName returns the template by name
@@ -126,18 +260,25 @@ func (t *Templating) getTemplateOptions() []string {
 	return tpls
 }
 
+// templateQuestion prompts for which template to use. It's the only
+// question a dry run needs, since Validate renders with synthetic
+// project data rather than the user's real answers.
+func (t *Templating) templateQuestion() *survey.Question {
+	return &survey.Question{
+		Name:     "Template",
+		Validate: survey.Required,
+		Prompt: &survey.Select{
+			Message: "What system are you using?",
+			Options: t.getTemplateOptions(),
+			Help:    "You can add additional templates in your config",
+		},
+	}
+}
+
 // GetQuestions return all required prompts
 func (t *Templating) GetQuestions() []*survey.Question {
 	qs := []*survey.Question{
-		{
-			Name:     "Template",
-			Validate: survey.Required,
-			Prompt: &survey.Select{
-				Message: "What system are you using?",
-				Options: t.getTemplateOptions(),
-				Help:    "You can add additional templates in your config",
-			},
-		},
+		t.templateQuestion(),
 		{
 			Name: "Name",
 			Prompt: &survey.Input{
@@ -196,6 +337,10 @@ func (t *Templating) Skip(path string, info os.FileInfo) (bool, error) {
 }
 
 func (t *Templating) startCommandSurvey() error {
+	if t.defaults || t.answersFile != "" {
+		return t.fillProjectFromAnswers()
+	}
+
 	var project = &ProjectData{}
 
 	// start command prompts
@@ -209,22 +354,138 @@ func (t *Templating) startCommandSurvey() error {
 	return nil
 }
 
+// answerValue looks up name in the answers file, falling back to def
+// when it's not present there.
+func (t *Templating) answerValue(name, def string) (string, bool) {
+	answers, err := t.loadAnswers()
+	if err != nil {
+		return "", false
+	}
+	if v, ok := answers[name]; ok {
+		return fmt.Sprintf("%v", v), true
+	}
+	if def != "" {
+		return def, true
+	}
+	return "", false
+}
+
+// requiredAnswerValue is answerValue for a field fillProjectFromAnswers
+// and resolveDryRunTemplate can't proceed without. It loads the answers
+// file itself, so a malformed or unreadable answers file is reported as
+// such instead of being mistaken for a missing field.
+func (t *Templating) requiredAnswerValue(name, def string) (string, error) {
+	if _, err := t.loadAnswers(); err != nil {
+		return "", err
+	}
+
+	v, ok := t.answerValue(name, def)
+	if !ok {
+		return "", fmt.Errorf("missing answer for required field %q", name)
+	}
+	return v, nil
+}
+
+// fillProjectFromAnswers builds the ProjectData from the answers file
+// and/or the declared question defaults, without prompting.
+func (t *Templating) fillProjectFromAnswers() error {
+	project := &ProjectData{}
+
+	template, err := t.requiredAnswerValue("Template", "")
+	if err != nil {
+		return err
+	}
+	project.Template = template
+
+	name, err := t.requiredAnswerValue("Name", "")
+	if err != nil {
+		return err
+	}
+	project.Name = name
+
+	if description, ok := t.answerValue("Description", ""); ok {
+		project.Description = description
+	}
+
+	dest, err := t.requiredAnswerValue("Path", "src")
+	if err != nil {
+		return err
+	}
+	project.Path = dest
+
+	t.project = project
+
+	return nil
+}
+
+// resolveDryRunTemplate figures out which template to validate without
+// asking any of the project-specific questions Run asks for a real
+// generation - a dry run never writes to the user's destination, so
+// Name/Path/Description and the template's own survey are never needed.
+func (t *Templating) resolveDryRunTemplate() (string, error) {
+	if t.defaults || t.answersFile != "" {
+		return t.requiredAnswerValue("Template", "")
+	}
+
+	var answer struct{ Template string }
+	if err := survey.Ask([]*survey.Question{t.templateQuestion()}, &answer); err != nil {
+		return "", err
+	}
+
+	return answer.Template, nil
+}
+
+// runDryRun validates the template straight from the local registry
+// cache, fetching it first if necessary, so --dry-run never prompts for
+// or writes to the user's real destination.
+func (t *Templating) runDryRun() error {
+	name, err := t.resolveDryRunTemplate()
+	if err != nil {
+		return err
+	}
+
+	tpl := t.getTemplateByName(name)
+	if tpl == nil {
+		return fmt.Errorf("template %s could not be found", name)
+	}
+
+	cachedPath, err := t.ensureTemplateCached(tpl)
+	if err != nil {
+		return err
+	}
+
+	report, err := t.Validate(cachedPath)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range report.Issues {
+		logy.WithFields(logy.Fields{"path": issue.Path, "kind": issue.Kind}).Error(issue.Message)
+	}
+
+	fmt.Printf("Dry run: %d issue(s) found\n", len(report.Issues))
+
+	return nil
+}
+
 func (t *Templating) startTemplateSurvey(path string) error {
 	surveyResults := make(map[string]interface{})
-	surveys, err := ReadSurveyConfig(path)
+
+	manifest, err := ReadSurveyConfig(path)
 	if err == nil {
-		questions, err := BuildSurveys(surveys)
+		prompts, err := BuildSurveys(manifest)
 		if err != nil {
 			logy.WithError(err).Error("build surveys")
 			return err
 		}
 
-		err = survey.Ask(questions, &surveyResults)
-
+		err = t.runPrompts(prompts, surveyResults)
 		if err != nil {
 			logy.WithError(err).Error("start survey")
 			return err
 		}
+
+		t.manifest = manifest
 	}
 
 	t.surveyResult = surveyResults
@@ -236,6 +497,10 @@ func (t *Templating) startTemplateSurvey(path string) error {
 
 // Run the command
 func (t *Templating) Run() error {
+	if t.dryRun {
+		return t.runDryRun()
+	}
+
 	err := t.startCommandSurvey()
 	if err != nil {
 		return err
@@ -251,7 +516,7 @@ func (t *Templating) Run() error {
 		s.Suffix = "Cloning repository..."
 		s.FinalMSG = "Repository cloned!\n"
 		s.Start()
-		err := t.cloneRepo(tpl.Url, t.project.Path)
+		err := t.cloneRepo(tpl, t.project.Path)
 		s.Stop()
 		if err != nil {
 			return err
@@ -270,6 +535,15 @@ func (t *Templating) Run() error {
 		return err
 	}
 
+	t.renderDate = time.Now().Format(time.RFC3339)
+	t.renderYear = time.Now().Year()
+
+	if t.manifest != nil {
+		if err := t.runHooks(t.manifest.Hooks.BeforeRender, t.project.Path); err != nil {
+			return err
+		}
+	}
+
 	// spinner progress
 	spinner := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
 	spinner.Suffix = "Processing templates..."
@@ -279,12 +553,12 @@ func (t *Templating) Run() error {
 	// start multiple routines
 	t.startN(runtime.NumCPU())
 
-	// close sync.WaitGroup and spinner when finished
-	defer func() {
-		t.stop()
-		spinner.Stop()
-		fmt.Printf("\nTotal: %s sec \n", strconv.FormatFloat(time.Since(startTime).Seconds(), 'f', 2, 64))
-	}()
+	// safety net: quiesce the worker pool and spinner on any early
+	// return. Once templating finishes we stop them explicitly (below)
+	// so AfterRender hooks don't have to share the terminal with the
+	// spinner animation.
+	defer t.stop()
+	defer spinner.Stop()
 
 	var templateData = struct {
 		Project *ProjectData
@@ -293,210 +567,206 @@ func (t *Templating) Run() error {
 		Vars    map[string]string
 	}{
 		t.project,
-		time.Now().Format(time.RFC3339),
-		time.Now().Year(),
+		t.renderDate,
+		t.renderYear,
 		t.Variables,
 	}
 
-	utilFuncMap := template.FuncMap{
-		"toCamelCase":  casee.ToCamelCase,
-		"toPascalCase": casee.ToPascalCase,
-		"toSnakeCase":  casee.ToSnakeCase,
-		"join":         strings.Join,
-		"getSurveyResult": func(key string) interface{} {
-			val, ok := t.surveyResult[key]
+	utilFuncMap := HelperFuncMap()
+	utilFuncMap["getSurveyResult"] = func(key string) interface{} {
+		val, ok := t.surveyResult[key]
+		if ok {
+			v, ok := val.(string)
 			if ok {
-				v, ok := val.(string)
-				if ok {
-					return v
-				}
-				return val
+				return v
 			}
-			fmt.Printf("%+v, %v \n", val, ok)
-			ctx.Errorf("map access with key '%s' failed", key)
-
 			return val
-		},
+		}
+		fmt.Printf("%+v, %v \n", val, ok)
+		ctx.Errorf("map access with key '%s' failed", key)
+
+		return val
+	}
+
+	onWalkErr := func(path string, err error) error {
+		return err
+	}
+
+	dirs, _, walkDirErr := t.walkTemplateTree(t.project.Path, onWalkErr)
+	if walkDirErr != nil {
+		return walkDirErr
 	}
 
 	renamings := make(map[string]string)
+	var renameMu sync.Mutex
+	var dirWg sync.WaitGroup
 
 	// iterate through all directorys
-	walkDirErr := filepath.Walk(
-		t.project.Path,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+	for _, d := range dirs {
+		d := d
 
-			// preserve files from processing
-			if !info.IsDir() {
-				return nil
-			}
+		ctx := logy.WithFields(logy.Fields{
+			"path": d.Path,
+			"size": d.Info.Size(),
+			"dir":  d.Info.IsDir(),
+		})
 
-			skipFile, skipDirErr := t.Skip(path, info)
-			if skipFile {
-				return nil
-			}
-			if skipDirErr != nil {
-				return skipDirErr
-			}
+		dirWg.Add(1)
 
-			ctx := logy.WithFields(logy.Fields{
-				"path": path,
-				"size": info.Size(),
-				"dir":  info.IsDir(),
-			})
-
-			// template directorys
-			t.ch <- func() {
-
-				defer func() {
-					if r := recover(); r != nil {
-						ctx.Error("directory templating error")
-					}
-				}()
-
-				// Template directory
-				tplDir, err := template.New(path).
-					Delims(startDelim, endDelim).
-					Funcs(utilFuncMap).
-					Parse(info.Name())
-
-				if err != nil {
-					ctx.WithError(err).Error("create template for directory")
-				}
+		// template directorys
+		t.ch <- func() {
+			defer dirWg.Done()
 
-				var dirNameBuffer bytes.Buffer
-				err = tplDir.Execute(&dirNameBuffer, templateData)
-				if err != nil {
-					ctx.WithError(err).Error("execute template for directory")
+			defer func() {
+				if r := recover(); r != nil {
+					ctx.Error("directory templating error")
 				}
+			}()
 
-				newDirectory := dirNameBuffer.String()
-				newPath := filepath.Join(filepath.Dir(path), newDirectory)
+			// Template directory
+			newDirectory, err := renderTemplate(d.Path, d.Info.Name(), templateData, utilFuncMap, false)
+			if err != nil {
+				ctx.WithError(err).Error("render template for directory")
+				return
+			}
 
-				if path != newPath {
-					renamings[path] = newPath
-				}
+			newPath := filepath.Join(filepath.Dir(d.Path), newDirectory)
+			if d.Path == newPath {
+				return
 			}
 
-			return nil
-		})
+			renameMu.Lock()
+			defer renameMu.Unlock()
 
-	if walkDirErr != nil {
-		return walkDirErr
+			if prev, ok := renamings[newPath]; ok {
+				ctx.Errorf("rename collision: both %q and %q would become %q, keeping %q", prev, d.Path, newPath, prev)
+				return
+			}
+			renamings[newPath] = d.Path
+		}
+	}
+
+	// wait for every directory to be rendered before acting on renamings,
+	// otherwise we'd race the rename against still-running renders
+	dirWg.Wait()
+
+	// rename dirs, keyed by their new path so a collision can only ever
+	// have been recorded once above. Deepest first, since a child's
+	// recorded old path still embeds its parent's un-rendered name -
+	// renaming the parent first would move the child out from under it.
+	oldPaths := make([]string, 0, len(renamings))
+	newPathFor := make(map[string]string, len(renamings))
+	for newPath, oldPath := range renamings {
+		oldPaths = append(oldPaths, oldPath)
+		newPathFor[oldPath] = newPath
+	}
+	sort.Slice(oldPaths, func(i, j int) bool {
+		return strings.Count(oldPaths[i], string(filepath.Separator)) > strings.Count(oldPaths[j], string(filepath.Separator))
+	})
+	for _, oldPath := range oldPaths {
+		newPath := newPathFor[oldPath]
+		if err := os.Rename(oldPath, newPath); err != nil {
+			logy.WithError(err).Errorf("rename directory '%s' to '%s'", oldPath, newPath)
+		}
 	}
 
-	// rename and remove dirs
-	for oldPath, newPath := range renamings {
-		os.Rename(oldPath, newPath)
-		os.RemoveAll(oldPath)
+	// re-walk for files now that directories have settled into their
+	// rendered names, so file paths aren't stale from before the renames
+	_, files, walkFileErr := t.walkTemplateTree(t.project.Path, onWalkErr)
+	if walkFileErr != nil {
+		return walkFileErr
 	}
 
+	var fileWg sync.WaitGroup
+
 	// iterate through all files
-	walkErr := filepath.Walk(t.project.Path,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+	for _, f := range files {
+		f := f
 
-			skipFile, skipDirErr := t.Skip(path, info)
-			if skipFile {
-				ctx.Debug("skip file")
-				return nil
-			}
-			if skipDirErr != nil {
-				ctx.Debug("skip directory")
-				return skipDirErr
-			}
+		ctx := logy.WithFields(logy.Fields{
+			"path": f.Path,
+			"size": f.Info.Size(),
+			"dir":  f.Info.IsDir(),
+		})
 
-			// preserve directorys from processing
-			if info.IsDir() {
-				return nil
-			}
+		fileWg.Add(1)
 
-			ctx := logy.WithFields(logy.Fields{
-				"path": path,
-				"size": info.Size(),
-				"dir":  info.IsDir(),
-			})
-
-			// template file
-			t.ch <- func() {
-
-				defer func() {
-					if r := recover(); r != nil {
-						ctx.Error("templating error")
-					}
-				}()
-
-				// Template filename
-				tplFilename, err := template.New(path).
-					Delims(startDelim, endDelim).
-					Funcs(utilFuncMap).
-					Parse(info.Name())
-
-				if err != nil {
-					ctx.WithError(err).Error("create template for filename")
-					return
-				}
+		// template file
+		t.ch <- func() {
+			defer fileWg.Done()
 
-				var filenameBuffer bytes.Buffer
-				err = tplFilename.Execute(&filenameBuffer, templateData)
-				if err != nil {
-					ctx.WithError(err).Error("execute template for filename")
-					return
+			defer func() {
+				if r := recover(); r != nil {
+					ctx.Error("templating error")
 				}
+			}()
 
-				newFilename := filenameBuffer.String()
-				newPath := filepath.Join(filepath.Dir(path), newFilename)
-				dat, err := ioutil.ReadFile(path)
+			// Template filename
+			newFilename, err := renderTemplate(f.Path, f.Info.Name(), templateData, utilFuncMap, false)
+			if err != nil {
+				ctx.WithError(err).Error("render template for filename")
+				return
+			}
+
+			newPath := filepath.Join(filepath.Dir(f.Path), newFilename)
 
-				if err != nil {
-					ctx.WithError(err).Error("read")
+			if newPath != f.Path && !t.force {
+				if _, err := os.Stat(newPath); err == nil {
+					ctx.Errorf("destination file '%s' already exists, run with --force to overwrite", newPath)
 					return
 				}
+			}
 
-				// Template file content
-				tmpl, err := template.New(newPath).
-					Delims(startDelim, endDelim).
-					Funcs(utilFuncMap).
-					Parse(string(dat))
+			dat, err := ioutil.ReadFile(f.Path)
 
-				if err != nil {
-					ctx.WithError(err).Error("parse")
-					return
-				}
+			if err != nil {
+				ctx.WithError(err).Error("read")
+				return
+			}
 
-				f, err := os.Create(newPath)
+			// Template file content
+			rendered, err := renderTemplate(newPath, string(dat), templateData, utilFuncMap, false)
+			if err != nil {
+				ctx.WithError(err).Error("render template for file")
+				return
+			}
 
-				if err != nil {
-					ctx.WithError(err).Error("create")
-					return
-				}
+			out, err := os.Create(newPath)
 
-				defer f.Close()
+			if err != nil {
+				ctx.WithError(err).Error("create")
+				return
+			}
 
-				err = tmpl.Execute(f, templateData)
+			defer out.Close()
 
-				if err != nil {
-					ctx.WithError(err).Error("template")
-					return
-				}
+			_, err = out.WriteString(rendered)
 
-				// remove old file when the name was changed
-				if path != newPath {
-					ctx.Debug("filename changed")
-					os.Remove(path)
-				}
+			if err != nil {
+				ctx.WithError(err).Error("write")
+				return
 			}
 
-			return nil
-		})
+			// remove old file when the name was changed
+			if f.Path != newPath {
+				ctx.Debug("filename changed")
+				os.Remove(f.Path)
+			}
+		}
+	}
+
+	// wait for every file to finish rendering, then quiesce the worker
+	// pool and spinner before AfterRender hooks write to stdout/stderr -
+	// otherwise their output interleaves with the spinner animation
+	fileWg.Wait()
+	t.stop()
+	spinner.Stop()
+	fmt.Printf("\nTotal: %s sec \n", strconv.FormatFloat(time.Since(startTime).Seconds(), 'f', 2, 64))
 
-	if walkErr != nil {
-		return walkErr
+	if t.manifest != nil {
+		if err := t.runHooks(t.manifest.Hooks.AfterRender, t.project.Path); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -519,9 +789,14 @@ func (t *Templating) start() {
 }
 
 // stop loop.
+// stop closes the job channel and waits for every worker to drain it.
+// Safe to call more than once - Run quiesces the pool before AfterRender
+// hooks and relies on a deferred stop() as a safety net for early returns.
 func (t *Templating) stop() {
-	close(t.ch)
-	t.wg.Wait()
+	t.stopOnce.Do(func() {
+		close(t.ch)
+		t.wg.Wait()
+	})
 }
 
 // toMap returns a map from slice.
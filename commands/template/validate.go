@@ -0,0 +1,135 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// ValidationIssue is a single problem found while linting a template.
+	ValidationIssue struct {
+		Path    string
+		Kind    string
+		Message string
+	}
+
+	// ValidationReport collects every issue found by Validate.
+	ValidationReport struct {
+		Issues []ValidationIssue
+	}
+)
+
+// Issue kinds reported by Validate.
+const (
+	IssueUnresolvedVariable = "unresolved-variable"
+	IssueUndefinedHelper    = "undefined-helper"
+	IssueUnreadableFile     = "unreadable-file"
+	IssueRenameCollision    = "rename-collision"
+	IssueTemplateError      = "template-error"
+)
+
+// OK reports whether the template is free of issues.
+func (r *ValidationReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *ValidationReport) add(path, kind, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ValidationIssue{
+		Path:    path,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// classifyTemplateError maps a text/template parse/execute error to one
+// of the ValidationIssue kinds.
+func classifyTemplateError(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "function") && strings.Contains(msg, "not defined"):
+		return IssueUndefinedHelper
+	case strings.Contains(msg, "map has no entry for key"):
+		return IssueUnresolvedVariable
+	default:
+		return IssueTemplateError
+	}
+}
+
+// Validate walks the cloned template at path without writing anything,
+// parsing every directory name, filename and file body with Butler's
+// delimiters and reporting unresolved variables, undefined helpers,
+// unreadable files and rename collisions. It shares its walk with Run
+// via walkTemplateTree and its rendering via renderTemplate, and is also
+// what WithDryRun(true) runs instead of writing to disk.
+func (t *Templating) Validate(root string) (*ValidationReport, error) {
+	report := &ValidationReport{}
+
+	data := struct {
+		Project *ProjectData
+		Date    string
+		Year    int
+		Vars    map[string]string
+	}{
+		&ProjectData{Name: "example", Path: root},
+		"",
+		0,
+		t.Variables,
+	}
+
+	funcMap := HelperFuncMap()
+	funcMap["getSurveyResult"] = func(key string) interface{} { return "" }
+
+	dirs, files, err := t.walkTemplateTree(root, func(p string, err error) error {
+		report.add(p, IssueUnreadableFile, "%s", err)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	seenDirOutputs := make(map[string]string)
+
+	for _, d := range dirs {
+		newName, err := renderTemplate(d.Path, d.Info.Name(), data, funcMap, true)
+		if err != nil {
+			report.add(d.Path, classifyTemplateError(err), "%s", err)
+			continue
+		}
+
+		newPath := filepath.Join(filepath.Dir(d.Path), newName)
+		if prev, ok := seenDirOutputs[newPath]; ok {
+			report.add(d.Path, IssueRenameCollision, "both %q and %q would render to %q", prev, d.Path, newPath)
+		}
+		seenDirOutputs[newPath] = d.Path
+	}
+
+	seenFileOutputs := make(map[string]string)
+
+	for _, f := range files {
+		newName, err := renderTemplate(f.Path, f.Info.Name(), data, funcMap, true)
+		if err != nil {
+			report.add(f.Path, classifyTemplateError(err), "%s", err)
+			continue
+		}
+
+		newPath := filepath.Join(filepath.Dir(f.Path), newName)
+		if prev, ok := seenFileOutputs[newPath]; ok {
+			report.add(f.Path, IssueRenameCollision, "both %q and %q would render to %q", prev, f.Path, newPath)
+		}
+		seenFileOutputs[newPath] = f.Path
+
+		dat, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			report.add(f.Path, IssueUnreadableFile, "%s", err)
+			continue
+		}
+
+		if _, err := renderTemplate(newPath, string(dat), data, funcMap, true); err != nil {
+			report.add(f.Path, classifyTemplateError(err), "%s", err)
+		}
+	}
+
+	return report, nil
+}
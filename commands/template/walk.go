@@ -0,0 +1,50 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// walkEntry pairs a path encountered while walking a template tree with
+// the os.FileInfo filepath.Walk produced for it.
+type walkEntry struct {
+	Path string
+	Info os.FileInfo
+}
+
+// walkTemplateTree walks root once, applying Skip's hidden-file and
+// blacklist rules to decide what descends and what's kept, and splits
+// the survivors into directories and files, in the order filepath.Walk
+// visits them. Run and Validate both build their two-pass processing on
+// top of this, so the skip/descend semantics can't drift between them
+// the way a second hand-rolled walk would let them.
+//
+// onWalkErr is invoked for every raw error filepath.Walk reports (e.g. a
+// permission error reading an entry); returning it aborts the walk like
+// Run wants, while recording an issue and returning nil keeps going like
+// Validate wants.
+func (t *Templating) walkTemplateTree(root string, onWalkErr func(path string, err error) error) (dirs, files []walkEntry, err error) {
+	err = filepath.Walk(root, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return onWalkErr(p, walkErr)
+		}
+
+		skip, skipErr := t.Skip(p, info)
+		if skip {
+			return nil
+		}
+		if skipErr != nil {
+			return skipErr
+		}
+
+		if info.IsDir() {
+			dirs = append(dirs, walkEntry{p, info})
+		} else {
+			files = append(files, walkEntry{p, info})
+		}
+
+		return nil
+	})
+
+	return dirs, files, err
+}
@@ -0,0 +1,21 @@
+package config
+
+// Template describes a single entry of the `templates` list in Butler's
+// own config file.
+type Template struct {
+	// Name identifies the template in prompts and on the command line.
+	Name string
+	// Url is the template source location: a git remote, a local path,
+	// or an archive URL, depending on Type.
+	Url string
+	// Branch pins a git source to a branch. Mutually exclusive with Tag.
+	Branch string
+	// Tag pins a git source to a tag. Mutually exclusive with Branch.
+	Tag string
+	// Subdir scopes a git source to a subdirectory of the repository,
+	// so multiple templates can live in one monorepo.
+	Subdir string
+	// Type selects the Source implementation: "git" (default), "local"
+	// or "archive".
+	Type string
+}